@@ -0,0 +1,162 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+// Package api exposes a simulation.Simulation over gRPC, generated from
+// proto/ts2sim/v1/ts2sim.proto. Run `buf generate` to (re)produce the
+// gen/ts2sim/v1 stubs this package depends on.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	ts2simv1 "github.com/ts2/ts2-sim-server/gen/ts2sim/v1"
+	"github.com/ts2/ts2-sim-server/simulation"
+)
+
+// Server implements ts2simv1.Ts2SimServiceServer on top of a
+// simulation.Simulation.
+type Server struct {
+	ts2simv1.UnimplementedTs2SimServiceServer
+
+	sim *simulation.Simulation
+}
+
+// NewServer returns a Server that drives sim.
+func NewServer(sim *simulation.Simulation) *Server {
+	return &Server{sim: sim}
+}
+
+// Start starts the simulation clock.
+func (s *Server) Start(ctx context.Context, req *ts2simv1.StartRequest) (*ts2simv1.StartResponse, error) {
+	s.sim.Start()
+	return &ts2simv1.StartResponse{}, nil
+}
+
+// Pause stops the simulation clock.
+func (s *Server) Pause(ctx context.Context, req *ts2simv1.PauseRequest) (*ts2simv1.PauseResponse, error) {
+	s.sim.Pause()
+	return &ts2simv1.PauseResponse{}, nil
+}
+
+// SetTimeFactor changes the real-time scale factor of the simulation
+// clock.
+func (s *Server) SetTimeFactor(ctx context.Context, req *ts2simv1.SetTimeFactorRequest) (*ts2simv1.SetTimeFactorResponse, error) {
+	s.sim.SetTimeFactor(req.Factor)
+	return &ts2simv1.SetTimeFactorResponse{}, nil
+}
+
+// ActivateRoute activates the requested route.
+func (s *Server) ActivateRoute(ctx context.Context, req *ts2simv1.ActivateRouteRequest) (*ts2simv1.ActivateRouteResponse, error) {
+	route, ok := s.sim.Routes[int(req.RouteId)]
+	if !ok {
+		return nil, fmt.Errorf("no such route: %d", req.RouteId)
+	}
+	if err := route.Activate(req.Persistent); err != nil {
+		return nil, err
+	}
+	return &ts2simv1.ActivateRouteResponse{}, nil
+}
+
+// DeactivateRoute deactivates the requested route.
+func (s *Server) DeactivateRoute(ctx context.Context, req *ts2simv1.DeactivateRouteRequest) (*ts2simv1.DeactivateRouteResponse, error) {
+	route, ok := s.sim.Routes[int(req.RouteId)]
+	if !ok {
+		return nil, fmt.Errorf("no such route: %d", req.RouteId)
+	}
+	if err := route.Deactivate(); err != nil {
+		return nil, err
+	}
+	return &ts2simv1.DeactivateRouteResponse{}, nil
+}
+
+// Subscribe streams every Event sim emits until the client disconnects.
+// It registers its own subscriber channel via simulation.Subscribe, so it
+// sees every Event regardless of how many other Subscribe calls or
+// Journals are running at the same time.
+func (s *Server) Subscribe(req *ts2simv1.SubscribeRequest, stream ts2simv1.Ts2SimService_SubscribeServer) error {
+	events, unsubscribe := s.sim.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case evt, ok := <-events:
+			if !ok {
+				return nil
+			}
+			payload, err := json.Marshal(evt.Object)
+			if err != nil {
+				return fmt.Errorf("unable to encode event %s: %s", evt.Name, err)
+			}
+			if err := stream.Send(&ts2simv1.Event{Name: string(evt.Name), Payload: string(payload)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ListTrackItems returns the current state of every TrackItem.
+func (s *Server) ListTrackItems(ctx context.Context, req *ts2simv1.ListTrackItemsRequest) (*ts2simv1.ListTrackItemsResponse, error) {
+	resp := &ts2simv1.ListTrackItemsResponse{}
+	for _, ti := range s.sim.TrackItems {
+		item := &ts2simv1.TrackItem{
+			Id:   int32(ti.ID()),
+			Type: string(ti.Type()),
+		}
+		if active := ti.ActiveRoute(); active != nil {
+			item.ActiveRouteId = int32(active.ID)
+		}
+		if si, ok := ti.(*simulation.SignalItem); ok {
+			if aspect := si.ActiveAspect(); aspect != nil {
+				item.ActiveAspect = &ts2simv1.SignalAspect{Name: aspect.Name}
+			}
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp, nil
+}
+
+// ListTrains returns the current state of every running Train.
+func (s *Server) ListTrains(ctx context.Context, req *ts2simv1.ListTrainsRequest) (*ts2simv1.ListTrainsResponse, error) {
+	resp := &ts2simv1.ListTrainsResponse{}
+	for _, tr := range s.sim.Trains {
+		resp.Trains = append(resp.Trains, &ts2simv1.Train{
+			ServiceCode: tr.ServiceCode(),
+			Speed:       tr.Speed(),
+		})
+	}
+	return resp, nil
+}
+
+// ListRoutes returns the current state of every Route.
+func (s *Server) ListRoutes(ctx context.Context, req *ts2simv1.ListRoutesRequest) (*ts2simv1.ListRoutesResponse, error) {
+	resp := &ts2simv1.ListRoutesResponse{}
+	for _, route := range s.sim.Routes {
+		resp.Routes = append(resp.Routes, &ts2simv1.Route{
+			Id:            int32(route.ID),
+			BeginSignalId: int32(route.BeginSignalId),
+			EndSignalId:   int32(route.EndSignalId),
+			Active:        route.Active(),
+		})
+	}
+	return resp, nil
+}
+
+var _ ts2simv1.Ts2SimServiceServer = new(Server)
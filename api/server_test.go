@@ -0,0 +1,102 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package api
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	ts2simv1 "github.com/ts2/ts2-sim-server/gen/ts2sim/v1"
+	"github.com/ts2/ts2-sim-server/simulation"
+)
+
+func TestActivateRouteUnknownRoute(t *testing.T) {
+	srv := NewServer(&simulation.Simulation{Routes: map[int]*simulation.Route{}})
+
+	_, err := srv.ActivateRoute(context.Background(), &ts2simv1.ActivateRouteRequest{RouteId: 42})
+	if err == nil {
+		t.Fatal("ActivateRoute with an unknown route id should return an error")
+	}
+}
+
+func TestDeactivateRouteUnknownRoute(t *testing.T) {
+	srv := NewServer(&simulation.Simulation{Routes: map[int]*simulation.Route{}})
+
+	_, err := srv.DeactivateRoute(context.Background(), &ts2simv1.DeactivateRouteRequest{RouteId: 42})
+	if err == nil {
+		t.Fatal("DeactivateRoute with an unknown route id should return an error")
+	}
+}
+
+func TestListRoutesReportsIdAndActiveState(t *testing.T) {
+	route := &simulation.Route{ID: 1, BeginSignalId: 2, EndSignalId: 3}
+	sim := &simulation.Simulation{Routes: map[int]*simulation.Route{1: route}}
+	srv := NewServer(sim)
+
+	resp, err := srv.ListRoutes(context.Background(), &ts2simv1.ListRoutesRequest{})
+	if err != nil {
+		t.Fatalf("ListRoutes() = %s", err)
+	}
+	if len(resp.Routes) != 1 {
+		t.Fatalf("ListRoutes() returned %d routes, want 1", len(resp.Routes))
+	}
+	got := resp.Routes[0]
+	if got.Id != 1 || got.BeginSignalId != 2 || got.EndSignalId != 3 {
+		t.Fatalf("ListRoutes() = %+v, want id=1 beginSignalId=2 endSignalId=3", got)
+	}
+	if got.Active {
+		t.Fatalf("ListRoutes() reported Active=true for a route that was never activated")
+	}
+}
+
+func TestSubscribeStopsWhenSimulationNeverStarted(t *testing.T) {
+	sim := &simulation.Simulation{}
+	srv := NewServer(sim)
+
+	stream := &fakeSubscribeStream{ctx: context.Background()}
+	if err := srv.Subscribe(&ts2simv1.SubscribeRequest{}, stream); err != nil {
+		t.Fatalf("Subscribe() = %s", err)
+	}
+	if len(stream.sent) != 0 {
+		t.Fatalf("Subscribe on an unstarted simulation sent %d events, want 0", len(stream.sent))
+	}
+}
+
+// fakeSubscribeStream is a minimal stand-in for
+// ts2simv1.Ts2SimService_SubscribeServer, just enough to drive Subscribe
+// in a test without a real gRPC connection.
+type fakeSubscribeStream struct {
+	ctx  context.Context
+	sent []*ts2simv1.Event
+}
+
+func (s *fakeSubscribeStream) Context() context.Context { return s.ctx }
+
+func (s *fakeSubscribeStream) Send(evt *ts2simv1.Event) error {
+	s.sent = append(s.sent, evt)
+	return nil
+}
+
+func (s *fakeSubscribeStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeSubscribeStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeSubscribeStream) SetTrailer(metadata.MD)       {}
+func (s *fakeSubscribeStream) SendMsg(m interface{}) error  { return nil }
+func (s *fakeSubscribeStream) RecvMsg(m interface{}) error  { return nil }
@@ -0,0 +1,38 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+//go:build tools
+// +build tools
+
+// Package api holds the hand-written gRPC/grpc-gateway server that wraps
+// simulation.Simulation. The generated stubs it depends on
+// (gen/ts2sim/v1/*.pb.go) are produced from proto/ts2sim/v1/ts2sim.proto by
+// running:
+//
+//	buf generate
+//
+// This file only exists so that `go mod tidy` keeps the buf plugin
+// binaries in go.sum; it is excluded from normal builds by the "tools"
+// build tag.
+package api
+
+import (
+	_ "github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-grpc-gateway"
+	_ "google.golang.org/grpc/cmd/protoc-gen-go-grpc"
+	_ "google.golang.org/protobuf/cmd/protoc-gen-go"
+)
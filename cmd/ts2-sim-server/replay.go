@@ -0,0 +1,74 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ts2/ts2-sim-server/simulation"
+)
+
+var replaySpeed float64
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <snapshot> <journal>",
+	Short: "Reconstruct and print the event timeline recorded by a previous run",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runReplay,
+}
+
+func init() {
+	replayCmd.Flags().Float64Var(&replaySpeed, "speed", 0, "replay speed factor (0 = as fast as possible)")
+	rootCmd.AddCommand(replayCmd)
+}
+
+func runReplay(cmd *cobra.Command, args []string) error {
+	snapshotPath, journalPath := args[0], args[1]
+
+	snapshotFile, err := os.Open(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("unable to open snapshot: %s", err)
+	}
+	defer snapshotFile.Close()
+
+	var snap simulation.Snapshot
+	if err := json.NewDecoder(snapshotFile).Decode(&snap); err != nil {
+		return fmt.Errorf("unable to decode snapshot: %s", err)
+	}
+	fmt.Printf("replaying from snapshot at %s\n", snap.Time)
+
+	journalFile, err := os.Open(journalPath)
+	if err != nil {
+		return fmt.Errorf("unable to open journal: %s", err)
+	}
+	defer journalFile.Close()
+
+	entries, err := simulation.Replay(journalFile, replaySpeed)
+	if err != nil {
+		return fmt.Errorf("unable to replay journal: %s", err)
+	}
+	for entry := range entries {
+		fmt.Printf("[%s] %s\n", entry.Time, entry.Event.Name)
+	}
+	return nil
+}
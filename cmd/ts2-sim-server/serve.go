@@ -0,0 +1,170 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+
+	ts2simv1 "github.com/ts2/ts2-sim-server/gen/ts2sim/v1"
+
+	"github.com/ts2/ts2-sim-server/api"
+	"github.com/ts2/ts2-sim-server/metrics"
+	"github.com/ts2/ts2-sim-server/plugins/routes"
+	"github.com/ts2/ts2-sim-server/simulation"
+)
+
+var (
+	serveListen               string
+	serveGatewayListen        string
+	serveMetricsListen        string
+	serveRoutesPlugin         string
+	serveRoutesPluginArgs     string
+	serveRoutesPluginFallback string
+	serveRoutesPluginTimeout  time.Duration
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve <simulation.json>",
+	Short: "Load a simulation and expose it over gRPC/REST until interrupted",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", ":9600", "address the gRPC server listens on")
+	serveCmd.Flags().StringVar(&serveGatewayListen, "gateway-listen", "", "address the REST/JSON gateway listens on (disabled if empty)")
+	serveCmd.Flags().StringVar(&serveMetricsListen, "metrics-listen", "", "address the Prometheus /metrics handler listens on (disabled if empty)")
+	serveCmd.Flags().StringVar(&serveRoutesPlugin, "routes-plugin", "", "path to an external RoutesManager plugin binary, wrapped with --routes-plugin-fallback and registered with simulation.RegisterRoutesManager (built-in StandardManager is used if this flag is empty)")
+	serveCmd.Flags().StringVar(&serveRoutesPluginArgs, "routes-plugin-args", "", "space-separated arguments passed to --routes-plugin on every invocation")
+	serveCmd.Flags().StringVar(&serveRoutesPluginFallback, "routes-plugin-fallback", "standard", "built-in RoutesManager to fall back to if --routes-plugin cannot be reached")
+	serveCmd.Flags().DurationVar(&serveRoutesPluginTimeout, "routes-plugin-timeout", 2*time.Second, "timeout for each --routes-plugin invocation")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	simFile, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to open simulation: %s", err)
+	}
+	defer simFile.Close()
+
+	var sim simulation.Simulation
+	if err := json.NewDecoder(simFile).Decode(&sim); err != nil {
+		return fmt.Errorf("unable to decode simulation: %s", err)
+	}
+
+	if serveRoutesPlugin != "" {
+		manager, err := newRoutesManager()
+		if err != nil {
+			return err
+		}
+		simulation.RegisterRoutesManager(manager)
+	}
+
+	if serveMetricsListen != "" {
+		sink := metrics.NewPrometheusSink()
+		sim.SetMetrics(sink)
+
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", sink.Handler())
+		go func() {
+			if err := http.ListenAndServe(serveMetricsListen, metricsMux); err != nil {
+				fmt.Fprintf(os.Stderr, "metrics server stopped: %s\n", err)
+			}
+		}()
+	}
+
+	lis, err := net.Listen("tcp", serveListen)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %s", serveListen, err)
+	}
+	grpcServer := grpc.NewServer()
+	ts2simv1.RegisterTs2SimServiceServer(grpcServer, api.NewServer(&sim))
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			fmt.Fprintf(os.Stderr, "gRPC server stopped: %s\n", err)
+		}
+	}()
+
+	if serveGatewayListen != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		gateway, err := api.NewGatewayHandler(ctx, serveListen)
+		if err != nil {
+			return fmt.Errorf("unable to start REST gateway: %s", err)
+		}
+		go func() {
+			if err := http.ListenAndServe(serveGatewayListen, gateway); err != nil {
+				fmt.Fprintf(os.Stderr, "gateway server stopped: %s\n", err)
+			}
+		}()
+	}
+
+	sim.Start()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	sim.Pause()
+	grpcServer.GracefulStop()
+	return nil
+}
+
+// newRoutesManager builds the RoutesManager described by the
+// --routes-plugin* flags: an ExternalManager that defers to
+// --routes-plugin-fallback whenever the plugin process itself cannot be
+// reached.
+func newRoutesManager() (simulation.RoutesManager, error) {
+	var pluginArgs []string
+	if serveRoutesPluginArgs != "" {
+		pluginArgs = strings.Fields(serveRoutesPluginArgs)
+	}
+	external, err := routes.NewExternalManager("external", serveRoutesPlugin, pluginArgs, serveRoutesPluginTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	fallback, err := builtinRoutesManager(serveRoutesPluginFallback)
+	if err != nil {
+		return nil, err
+	}
+	return routes.NewFallbackManager(external, fallback), nil
+}
+
+func builtinRoutesManager(name string) (simulation.RoutesManager, error) {
+	switch name {
+	case "standard":
+		return routes.StandardManager{}, nil
+	default:
+		return nil, fmt.Errorf("unknown built-in routes manager: %s", name)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+// Package metrics provides a Prometheus-backed simulation.Metrics sink, so
+// a server binary can expose /metrics alongside its existing API without
+// the simulation package taking a hard dependency on Prometheus.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ts2/ts2-sim-server/simulation"
+)
+
+// PrometheusSink is a simulation.Metrics implementation backed by a
+// dedicated prometheus.Registry, so tests and multiple simulations can
+// each assert on their own set of metrics instead of sharing the global
+// default registry.
+type PrometheusSink struct {
+	registry *prometheus.Registry
+
+	routeActivations *prometheus.CounterVec
+	tickDuration     prometheus.Histogram
+	activeTrains     prometheus.Gauge
+	activeRoutes     prometheus.Gauge
+	signalsAtDanger  prometheus.Gauge
+}
+
+// NewPrometheusSink creates a PrometheusSink with its own registry and
+// registers all of its collectors.
+func NewPrometheusSink() *PrometheusSink {
+	s := &PrometheusSink{
+		registry: prometheus.NewRegistry(),
+		routeActivations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "ts2",
+			Subsystem: "routes",
+			Name:      "activation_attempts_total",
+			Help:      "Route activation attempts, labelled by outcome and conflict reason.",
+		}, []string{"granted", "reason"}),
+		tickDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "ts2",
+			Subsystem: "simulation",
+			Name:      "tick_duration_seconds",
+			Help:      "Wall-clock time taken to process one Simulation.run tick.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		activeTrains: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "ts2",
+			Subsystem: "simulation",
+			Name:      "active_trains",
+			Help:      "Number of trains currently running in the simulation.",
+		}),
+		activeRoutes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "ts2",
+			Subsystem: "simulation",
+			Name:      "active_routes",
+			Help:      "Number of routes currently active in the simulation.",
+		}),
+		signalsAtDanger: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "ts2",
+			Subsystem: "simulation",
+			Name:      "signals_at_danger",
+			Help:      "Number of signals whose active aspect means stop.",
+		}),
+	}
+	s.registry.MustRegister(
+		s.routeActivations,
+		s.tickDuration,
+		s.activeTrains,
+		s.activeRoutes,
+		s.signalsAtDanger,
+	)
+	return s
+}
+
+// IncrRouteActivation implements simulation.Metrics.
+func (s *PrometheusSink) IncrRouteActivation(granted bool, reason string) {
+	s.routeActivations.WithLabelValues(boolLabel(granted), reason).Inc()
+}
+
+// ObserveTickDuration implements simulation.Metrics.
+func (s *PrometheusSink) ObserveTickDuration(d time.Duration) {
+	s.tickDuration.Observe(d.Seconds())
+}
+
+// SetActiveTrains implements simulation.Metrics.
+func (s *PrometheusSink) SetActiveTrains(n int) {
+	s.activeTrains.Set(float64(n))
+}
+
+// SetActiveRoutes implements simulation.Metrics.
+func (s *PrometheusSink) SetActiveRoutes(n int) {
+	s.activeRoutes.Set(float64(n))
+}
+
+// SetSignalsAtDanger implements simulation.Metrics.
+func (s *PrometheusSink) SetSignalsAtDanger(n int) {
+	s.signalsAtDanger.Set(float64(n))
+}
+
+// Handler returns the /metrics HTTP handler for this sink's registry, to
+// be mounted alongside the existing server.
+func (s *PrometheusSink) Handler() http.Handler {
+	return promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})
+}
+
+func boolLabel(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+var _ simulation.Metrics = new(PrometheusSink)
@@ -0,0 +1,51 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusSinkExposesReportedMetrics(t *testing.T) {
+	sink := NewPrometheusSink()
+	sink.IncrRouteActivation(true, "no_conflict")
+	sink.IncrRouteActivation(false, "conflicting_item_active")
+	sink.SetActiveTrains(3)
+	sink.SetActiveRoutes(2)
+	sink.SetSignalsAtDanger(1)
+
+	rr := httptest.NewRecorder()
+	sink.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		`ts2_routes_activation_attempts_total{granted="true",reason="no_conflict"} 1`,
+		`ts2_routes_activation_attempts_total{granted="false",reason="conflicting_item_active"} 1`,
+		`ts2_simulation_active_trains 3`,
+		`ts2_simulation_active_routes 2`,
+		`ts2_simulation_signals_at_danger 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
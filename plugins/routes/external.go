@@ -0,0 +1,243 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/ts2/ts2-sim-server/simulation"
+)
+
+// protocolVersion is the ExternalManager wire protocol this binary
+// speaks. It is negotiated with a plugin during the VERSION command, sent
+// the same way as every other command (JSON on stdin, JSON back on
+// stdout), so a plugin author only ever has to implement one invocation
+// convention. An incompatible plugin is rejected at startup rather than
+// failing confusingly mid-run.
+const protocolVersion = "1.0"
+
+// externalRoute is the denormalized, JSON-friendly view of a
+// simulation.Route sent to an external manager plugin.
+type externalRoute struct {
+	ID            int                 `json:"id"`
+	BeginSignalID int                 `json:"beginSignalId"`
+	EndSignalID   int                 `json:"endSignalId"`
+	Items         []externalRouteItem `json:"items"`
+}
+
+// externalRouteItem is one track item of an externalRoute, with enough of
+// its conflict state denormalized for a plugin to make a decision without
+// calling back into the simulation.
+type externalRouteItem struct {
+	ID             int    `json:"id"`
+	Type           string `json:"type"`
+	ActiveRouteID  int    `json:"activeRouteId,omitempty"`
+	ConflictItemID int    `json:"conflictItemId,omitempty"`
+	ConflictActive bool   `json:"conflictActive"`
+}
+
+// externalRequest is the JSON payload written to a plugin's stdin.
+type externalRequest struct {
+	Version string        `json:"version"`
+	Command string        `json:"command"`
+	Route   externalRoute `json:"route"`
+}
+
+// externalResponse is the JSON payload a plugin writes to stdout in reply
+// to a CAN_ACTIVATE or CAN_DEACTIVATE command.
+type externalResponse struct {
+	Allowed bool     `json:"allowed"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// externalVersionResponse is the JSON payload a plugin writes to stdout
+// in reply to a VERSION command.
+type externalVersionResponse struct {
+	Version string `json:"version"`
+}
+
+// ExternalManager implements simulation.RoutesManager by delegating
+// CanActivate/CanDeactivate decisions to an out-of-process binary: each
+// request is JSON-encoded to the plugin's stdin and the verdict is read
+// back from its stdout, so operators can experiment with ML-based or
+// rule-engine dispatchers without recompiling the server.
+type ExternalManager struct {
+	name    string
+	path    string
+	args    []string
+	timeout time.Duration
+}
+
+// NewExternalManager performs a VERSION handshake against path, and
+// returns an ExternalManager that invokes it for every
+// CanActivate/CanDeactivate decision thereafter. It returns an error if
+// the plugin cannot be started or does not speak protocolVersion, so
+// incompatible plugins are rejected at startup instead of stalling the
+// first route activation.
+func NewExternalManager(name, path string, args []string, timeout time.Duration) (*ExternalManager, error) {
+	em := &ExternalManager{name: name, path: path, args: args, timeout: timeout}
+	if err := em.handshake(); err != nil {
+		return nil, fmt.Errorf("routes plugin %q: %s", path, err)
+	}
+	return em, nil
+}
+
+func (em *ExternalManager) handshake() error {
+	payload, err := json.Marshal(externalRequest{Version: protocolVersion, Command: "VERSION"})
+	if err != nil {
+		return fmt.Errorf("unable to encode version request: %s", err)
+	}
+	out, err := em.invoke(payload)
+	if err != nil {
+		return fmt.Errorf("version handshake failed: %s", err)
+	}
+
+	var resp externalVersionResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return fmt.Errorf("invalid version response: %s", err)
+	}
+	if resp.Version != protocolVersion {
+		return fmt.Errorf("unsupported protocol version %q, want %q", resp.Version, protocolVersion)
+	}
+	return nil
+}
+
+// invoke runs the plugin binary with em.args, writing payload to its
+// stdin and returning what it wrote to stdout, bounded by em.timeout so a
+// hung plugin cannot stall the caller (handshake or ask) indefinitely.
+func (em *ExternalManager) invoke(payload []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), em.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, em.path, em.args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// Name of this manager.
+func (em *ExternalManager) Name() string {
+	return em.name
+}
+
+// CanActivate returns true if the plugin allows r to be activated. A
+// plugin that errors, times out, or returns an unparsable response is
+// treated as a rejection, so a hung plugin cannot stall Simulation.run.
+func (em *ExternalManager) CanActivate(r *simulation.Route) bool {
+	resp, err := em.ask("CAN_ACTIVATE", r)
+	return err == nil && resp.Allowed
+}
+
+// CanDeactivate returns true if the plugin allows r to be deactivated.
+func (em *ExternalManager) CanDeactivate(r *simulation.Route) bool {
+	resp, err := em.ask("CAN_DEACTIVATE", r)
+	return err == nil && resp.Allowed
+}
+
+func (em *ExternalManager) ask(command string, r *simulation.Route) (*externalResponse, error) {
+	payload, err := json.Marshal(externalRequest{
+		Version: protocolVersion,
+		Command: command,
+		Route:   denormalizeRoute(r),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode request: %s", err)
+	}
+
+	out, err := em.invoke(payload)
+	if err != nil {
+		return nil, fmt.Errorf("plugin invocation failed: %s", err)
+	}
+
+	var resp externalResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("invalid plugin response: %s", err)
+	}
+	return &resp, nil
+}
+
+func denormalizeRoute(r *simulation.Route) externalRoute {
+	er := externalRoute{ID: r.ID, BeginSignalID: r.BeginSignalId, EndSignalID: r.EndSignalId}
+	for _, pos := range r.Positions {
+		ti := pos.TrackItem()
+		item := externalRouteItem{ID: ti.ID(), Type: string(ti.Type())}
+		if active := ti.ActiveRoute(); active != nil {
+			item.ActiveRouteID = active.ID
+		}
+		if conflict := ti.ConflictItem(); conflict != nil {
+			item.ConflictItemID = conflict.ID()
+			item.ConflictActive = conflict.ActiveRoute() != nil
+		}
+		er.Items = append(er.Items, item)
+	}
+	return er
+}
+
+// FallbackManager tries an ExternalManager plugin first, falling back to
+// a named built-in simulation.RoutesManager (e.g. StandardManager) when
+// the plugin process itself fails or times out, as opposed to when it
+// legitimately rejects a route.
+type FallbackManager struct {
+	external *ExternalManager
+	fallback simulation.RoutesManager
+}
+
+// NewFallbackManager returns a FallbackManager that prefers external,
+// falling back to fallback.
+func NewFallbackManager(external *ExternalManager, fallback simulation.RoutesManager) *FallbackManager {
+	return &FallbackManager{external: external, fallback: fallback}
+}
+
+// Name of this manager.
+func (fm *FallbackManager) Name() string {
+	return fm.external.Name() + " (fallback: " + fm.fallback.Name() + ")"
+}
+
+// CanActivate asks the external plugin, falling back to fm.fallback if
+// the plugin itself could not be reached.
+func (fm *FallbackManager) CanActivate(r *simulation.Route) bool {
+	resp, err := fm.external.ask("CAN_ACTIVATE", r)
+	if err != nil {
+		return fm.fallback.CanActivate(r)
+	}
+	return resp.Allowed
+}
+
+// CanDeactivate asks the external plugin, falling back to fm.fallback if
+// the plugin itself could not be reached.
+func (fm *FallbackManager) CanDeactivate(r *simulation.Route) bool {
+	resp, err := fm.external.ask("CAN_DEACTIVATE", r)
+	if err != nil {
+		return fm.fallback.CanDeactivate(r)
+	}
+	return resp.Allowed
+}
+
+var (
+	_ simulation.RoutesManager = new(ExternalManager)
+	_ simulation.RoutesManager = new(FallbackManager)
+)
@@ -0,0 +1,168 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package routes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ts2/ts2-sim-server/simulation"
+)
+
+// writeFixturePlugin writes an executable shell script that reads the
+// JSON request off its own stdin and replies on its own stdout, the same
+// envelope ExternalManager uses for every command including VERSION.
+func writeFixturePlugin(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plugin.sh")
+	if err := os.WriteFile(path, []byte(body), 0o755); err != nil {
+		t.Fatalf("unable to write fixture plugin: %s", err)
+	}
+	return path
+}
+
+// versionRepliesScript is a fixture plugin that answers VERSION with
+// version and every other command with allowed, regardless of what the
+// request actually contains.
+func versionRepliesScript(version, allowed string) string {
+	return "#!/bin/sh\n" +
+		"req=\"$(cat)\"\n" +
+		"case \"$req\" in\n" +
+		"  *'\"command\":\"VERSION\"'*) echo '{\"version\":\"" + version + "\"}' ;;\n" +
+		"  *) echo '{\"allowed\":" + allowed + "}' ;;\n" +
+		"esac\n"
+}
+
+func TestNewExternalManagerRejectsWrongProtocolVersion(t *testing.T) {
+	path := writeFixturePlugin(t, versionRepliesScript("0.9", "true"))
+
+	if _, err := NewExternalManager("test", path, nil, time.Second); err == nil {
+		t.Fatal("expected a protocol version mismatch to be rejected")
+	}
+}
+
+func TestNewExternalManagerAcceptsMatchingProtocolVersion(t *testing.T) {
+	path := writeFixturePlugin(t, versionRepliesScript(protocolVersion, "true"))
+
+	em, err := NewExternalManager("test", path, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewExternalManager() = %s", err)
+	}
+	if got := em.Name(); got != "test" {
+		t.Fatalf("Name() = %q, want %q", got, "test")
+	}
+}
+
+func TestNewExternalManagerRejectsUnstartablePlugin(t *testing.T) {
+	if _, err := NewExternalManager("test", filepath.Join(t.TempDir(), "does-not-exist"), nil, time.Second); err == nil {
+		t.Fatal("expected a missing plugin binary to be rejected")
+	}
+}
+
+func TestCanActivateRoundTripsThroughThePlugin(t *testing.T) {
+	route := &simulation.Route{ID: 1, BeginSignalId: 2, EndSignalId: 3}
+
+	grant := writeFixturePlugin(t, versionRepliesScript(protocolVersion, "true"))
+	em, err := NewExternalManager("test", grant, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewExternalManager() = %s", err)
+	}
+	if !em.CanActivate(route) {
+		t.Error("CanActivate() = false, want true for a plugin that allows it")
+	}
+	if !em.CanDeactivate(route) {
+		t.Error("CanDeactivate() = false, want true for a plugin that allows it")
+	}
+
+	deny := writeFixturePlugin(t, versionRepliesScript(protocolVersion, "false"))
+	em, err = NewExternalManager("test", deny, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewExternalManager() = %s", err)
+	}
+	if em.CanActivate(route) {
+		t.Error("CanActivate() = true, want false for a plugin that denies it")
+	}
+}
+
+// slowScript answers VERSION immediately but sleeps past any reasonable
+// test timeout before replying to every other command, standing in for a
+// hung plugin.
+const slowScript = "#!/bin/sh\n" +
+	"req=\"$(cat)\"\n" +
+	"case \"$req\" in\n" +
+	"  *'\"command\":\"VERSION\"'*) echo '{\"version\":\"" + protocolVersion + "\"}' ;;\n" +
+	"  *) sleep 1; echo '{\"allowed\":true}' ;;\n" +
+	"esac\n"
+
+func TestCanActivateRejectsOnPluginTimeout(t *testing.T) {
+	path := writeFixturePlugin(t, slowScript)
+	em, err := NewExternalManager("test", path, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewExternalManager() = %s", err)
+	}
+	em.timeout = 50 * time.Millisecond
+
+	if em.CanActivate(&simulation.Route{ID: 1}) {
+		t.Error("CanActivate() = true, want false when the plugin times out")
+	}
+}
+
+// fakeRoutesManager is a minimal simulation.RoutesManager stand-in so
+// FallbackManager tests can assert on which manager actually decided.
+type fakeRoutesManager struct {
+	name     string
+	activate bool
+}
+
+func (m *fakeRoutesManager) Name() string                           { return m.name }
+func (m *fakeRoutesManager) CanActivate(r *simulation.Route) bool   { return m.activate }
+func (m *fakeRoutesManager) CanDeactivate(r *simulation.Route) bool { return m.activate }
+
+func TestFallbackManagerFallsBackWhenPluginIsUnreachable(t *testing.T) {
+	path := writeFixturePlugin(t, slowScript)
+	external, err := NewExternalManager("test", path, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewExternalManager() = %s", err)
+	}
+	external.timeout = 50 * time.Millisecond
+
+	fallback := &fakeRoutesManager{name: "fallback", activate: true}
+	fm := NewFallbackManager(external, fallback)
+
+	if !fm.CanActivate(&simulation.Route{ID: 1}) {
+		t.Error("CanActivate() = false, want the fallback manager's grant to win when the plugin times out")
+	}
+}
+
+func TestFallbackManagerPrefersThePluginWhenItResponds(t *testing.T) {
+	path := writeFixturePlugin(t, versionRepliesScript(protocolVersion, "false"))
+	external, err := NewExternalManager("test", path, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewExternalManager() = %s", err)
+	}
+
+	fallback := &fakeRoutesManager{name: "fallback", activate: true}
+	fm := NewFallbackManager(external, fallback)
+
+	if fm.CanActivate(&simulation.Route{ID: 1}) {
+		t.Error("CanActivate() = true, want the plugin's denial to win over the fallback's grant")
+	}
+}
@@ -29,6 +29,16 @@ type StandardManager struct{}
 // In this implementation, it checks route conflicts and returns
 // false if a conflict is found.
 func (sm StandardManager) CanActivate(r *simulation.Route) bool {
+	metrics := r.Metrics()
+	grant := func(reason string) bool {
+		metrics.IncrRouteActivation(true, reason)
+		return true
+	}
+	reject := func(reason string) bool {
+		metrics.IncrRouteActivation(false, reason)
+		return false
+	}
+
 	var flag bool
 	for _, pos := range r.Positions {
 		if pos.TrackItem().ID() == r.BeginSignalId || pos.TrackItem().ID() == r.EndSignalId {
@@ -36,12 +46,12 @@ func (sm StandardManager) CanActivate(r *simulation.Route) bool {
 		}
 		if pos.TrackItem().ConflictItem() != nil && pos.TrackItem().ConflictItem().ActiveRoute() != nil {
 			// Our trackItem has a conflicting item with an active route
-			return false
+			return reject("conflicting_item_active")
 		}
 		if pos.TrackItem().ActiveRoute() == nil {
 			if flag {
 				// We had a route with same direction but does not end with the same signal
-				return false
+				return reject("partial_active_route")
 			}
 			continue
 		}
@@ -49,22 +59,22 @@ func (sm StandardManager) CanActivate(r *simulation.Route) bool {
 		if pos.TrackItem().Type() == simulation.TypePoints && !flag {
 			// The trackItem is a pointsItem and it is the first
 			// trackItem with active route that we meet
-			return false
+			return reject("points_already_active")
 		}
 		if pos.PreviousItem().ID() != pos.TrackItem().ActiveRoutePreviousItem().ID() {
 			// The direction of route r is different from that of the active route of the TI
-			return false
+			return reject("opposite_direction")
 		}
 		if pos.TrackItem().ActiveRoute().ID == r.ID {
 			// Always allow to setup the same route again
-			return true
+			return grant("same_route_reactivated")
 		}
 		// We set flag to true to remember we have come across an item with activeRoute with
 		// the same direction. This enables the user to set a route ending with the same end
 		// signal when it is cleared by a train still on the route
 		flag = true
 	}
-	return true
+	return grant("no_conflict")
 }
 
 // CanDeactivate returns true if the given route can be deactivated.
@@ -0,0 +1,107 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package simulation
+
+import "sync"
+
+// eventBroadcaster fans every Event read off a Simulation's EventChan out
+// to any number of subscriber channels. A plain Go channel delivers each
+// value to exactly one receiver, so without this, a gRPC Subscribe stream
+// and a recording Journal running at the same time would nondeterministically
+// split events between them instead of each seeing every one.
+type eventBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan *Event]struct{}
+	done        chan struct{}
+}
+
+// subscriberBuffer is how many Events a slow subscriber can fall behind
+// by before newer Events are dropped for it rather than stalling the
+// broadcaster for everyone else.
+const subscriberBuffer = 64
+
+func newEventBroadcaster(source <-chan *Event) *eventBroadcaster {
+	b := &eventBroadcaster{
+		subscribers: make(map[chan *Event]struct{}),
+		done:        make(chan struct{}),
+	}
+	go b.run(source)
+	return b
+}
+
+func (b *eventBroadcaster) run(source <-chan *Event) {
+	for {
+		select {
+		case <-b.done:
+			return
+		case evt, ok := <-source:
+			if !ok {
+				return
+			}
+			b.mu.Lock()
+			for sub := range b.subscribers {
+				select {
+				case sub <- evt:
+				default:
+					logger.Warn("dropping event for slow subscriber", "event", evt.Name)
+				}
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+// subscribe registers a new subscriber channel that receives every Event
+// broadcast from here on.
+func (b *eventBroadcaster) subscribe() chan *Event {
+	sub := make(chan *Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// unsubscribe stops delivering to sub and closes it.
+func (b *eventBroadcaster) unsubscribe(sub chan *Event) {
+	b.mu.Lock()
+	delete(b.subscribers, sub)
+	b.mu.Unlock()
+	close(sub)
+}
+
+// stop shuts the broadcaster down. Subscribers are left open; callers are
+// expected to have unsubscribed already.
+func (b *eventBroadcaster) stop() {
+	close(b.done)
+}
+
+// Subscribe returns a channel that receives every Event sim emits from
+// now on, independently of any other Subscribe or Journal consumer, and
+// an unsubscribe function the caller must call once done with it. If sim
+// is not currently running, the returned channel is already closed.
+func (sim *Simulation) Subscribe() (events <-chan *Event, unsubscribe func()) {
+	b := sim.getBroadcaster()
+	if b == nil {
+		closed := make(chan *Event)
+		close(closed)
+		return closed, func() {}
+	}
+	sub := b.subscribe()
+	return sub, func() { b.unsubscribe(sub) }
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package simulation
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestSubscribeDuringStartStopIsRace exercises the exact pattern a gRPC
+// Subscribe handler invites: Subscribe called concurrently with Start/Pause
+// flipping sim.broadcaster. Run with -race; it never asserts anything
+// itself, it just must not trip the race detector.
+func TestSubscribeDuringStartStopIsRace(t *testing.T) {
+	sim := &Simulation{}
+	sim.UseSteppedClock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, unsubscribe := sim.Subscribe()
+			unsubscribe()
+		}
+	}()
+
+	sim.Start()
+	wg.Wait()
+	sim.Pause()
+}
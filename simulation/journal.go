@@ -0,0 +1,126 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// JournalEntry is one append-only record of an Event emitted by a
+// Simulation, together with the simulation Time it occurred at. A
+// sequence of JournalEntry records, combined with a Snapshot taken at the
+// start of the recording, is enough for Replay to reproduce a run
+// deterministically.
+type JournalEntry struct {
+	Time  Time   `json:"time"`
+	Event *Event `json:"event"`
+}
+
+// Journal appends every Event a Simulation emits to an underlying writer,
+// for later reproduction with Replay.
+type Journal struct {
+	sim         *Simulation
+	enc         *json.Encoder
+	events      <-chan *Event
+	unsubscribe func()
+	done        chan struct{}
+}
+
+// StartJournal begins recording every Event sim emits to w as
+// newline-delimited JSON, until Stop is called. It subscribes for its own
+// copy of every Event via sim.Subscribe, so recording runs independently
+// of any gRPC Subscribe stream (or other Journal) also consuming sim's
+// events. Take a Snapshot of sim before calling StartJournal so the
+// recording can later be replayed from a known starting state.
+func (sim *Simulation) StartJournal(w io.Writer) *Journal {
+	events, unsubscribe := sim.Subscribe()
+	j := &Journal{
+		sim:         sim,
+		enc:         json.NewEncoder(w),
+		events:      events,
+		unsubscribe: unsubscribe,
+		done:        make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+func (j *Journal) run() {
+	for {
+		select {
+		case <-j.done:
+			return
+		case evt, ok := <-j.events:
+			if !ok {
+				return
+			}
+			entry := JournalEntry{Time: j.sim.Options.CurrentTime, Event: evt}
+			if err := j.enc.Encode(entry); err != nil {
+				logger.Error("unable to write journal entry", "error", err)
+			}
+		}
+	}
+}
+
+// Stop ends recording and unsubscribes from sim's events. It does not
+// close the underlying writer.
+func (j *Journal) Stop() {
+	close(j.done)
+	j.unsubscribe()
+}
+
+// Replay reads a sequence of JournalEntry records from r and returns a
+// channel on which it re-emits them, each still paired with the
+// simulation Time it originally occurred at, spaced out accordingly.
+// speed scales the delay between entries the same way Clock.SetTimeFactor
+// scales a live run's ticks: 1 replays at the original pace, 4 four times
+// faster. A speed of 0 replays every entry back-to-back with no delay,
+// for golden file comparisons. The returned channel is closed once every
+// entry has been replayed.
+func Replay(r io.Reader, speed float64) (<-chan *JournalEntry, error) {
+	var entries []JournalEntry
+	dec := json.NewDecoder(r)
+	for {
+		var entry JournalEntry
+		if err := dec.Decode(&entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("unable to read journal: %s", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	out := make(chan *JournalEntry)
+	go func() {
+		defer close(out)
+		var last Time
+		for i := range entries {
+			if i > 0 && speed > 0 {
+				time.Sleep(time.Duration(float64(entries[i].Time.Sub(last)) / speed))
+			}
+			last = entries[i].Time
+			out <- &entries[i]
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package simulation
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// notifyOnWrite wraps a bytes.Buffer and closes done the first time Write
+// is called, so a test can wait for a Journal's background goroutine to
+// have recorded an entry instead of racing a fixed sleep against it.
+type notifyOnWrite struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	done chan struct{}
+}
+
+func (w *notifyOnWrite) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.buf.Write(p)
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+	return n, err
+}
+
+func TestJournalRecordsEmittedEvents(t *testing.T) {
+	sim := &Simulation{}
+	sim.UseSteppedClock()
+	sim.Start()
+	defer sim.Pause()
+
+	w := &notifyOnWrite{done: make(chan struct{})}
+	j := sim.StartJournal(w)
+	defer j.Stop()
+
+	sim.EventChan <- &Event{Name: CLOCK}
+
+	select {
+	case <-w.done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the journal to record an entry")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var entry JournalEntry
+	if err := json.Unmarshal(bytes.TrimSpace(w.buf.Bytes()), &entry); err != nil {
+		t.Fatalf("unable to decode journal entry: %s", err)
+	}
+	if entry.Event.Name != CLOCK {
+		t.Fatalf("recorded event %s, want %s", entry.Event.Name, CLOCK)
+	}
+}
+
+// TestReplayPreservesEventOrder checks that Replay re-emits every recorded
+// JournalEntry in its original order.
+func TestReplayPreservesEventOrder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	want := []EventType{CLOCK, SIGNAL_ASPECT_CHANGED, CLOCK}
+	for _, name := range want {
+		if err := enc.Encode(JournalEntry{Event: &Event{Name: name}}); err != nil {
+			t.Fatalf("unable to write fixture journal: %s", err)
+		}
+	}
+
+	entries, err := Replay(&buf, 0)
+	if err != nil {
+		t.Fatalf("Replay() = %s", err)
+	}
+
+	var got []EventType
+	for entry := range entries {
+		got = append(got, entry.Event.Name)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("replayed %d entries, want %d", len(got), len(want))
+	}
+	for i, name := range want {
+		if got[i] != name {
+			t.Fatalf("entry %d = %s, want %s", i, got[i], name)
+		}
+	}
+}
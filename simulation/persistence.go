@@ -0,0 +1,160 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package simulation
+
+import "fmt"
+
+// SnapshotVersion is the current format of Snapshot. It is bumped whenever
+// the shape of Snapshot changes in a way old clients cannot read.
+const SnapshotVersion = 1
+
+// TrainSnapshot is the live state of a single train captured by Snapshot.
+type TrainSnapshot struct {
+	ServiceCode string  `json:"service"`
+	TrackItemID int     `json:"trackItemId"`
+	Speed       float64 `json:"speed"`
+}
+
+// Snapshot is a point-in-time capture of a Simulation's live state: the
+// parts of it that change as the simulation runs, as opposed to the
+// static layout and rolling stock loaded by UnmarshalJSON. It composes
+// with that static definition: restoring one requires a Simulation
+// already unmarshaled from the same definition the snapshot was taken
+// from.
+type Snapshot struct {
+	Version int             `json:"version"`
+	Time    Time            `json:"time"`
+	Trains  []TrainSnapshot `json:"trains"`
+	Routes  []int           `json:"activeRoutes"`
+	Signals map[int]string  `json:"signalAspects"`
+	Log     []string        `json:"messageLog"`
+}
+
+// Snapshot captures sim's current time, train positions and speeds,
+// active routes, signal aspects and message log into a versioned,
+// JSON-serializable Snapshot.
+func (sim *Simulation) Snapshot() *Snapshot {
+	snap := &Snapshot{
+		Version: SnapshotVersion,
+		Time:    sim.Options.CurrentTime,
+		Signals: make(map[int]string),
+	}
+
+	for _, tr := range sim.Trains {
+		snap.Trains = append(snap.Trains, TrainSnapshot{
+			ServiceCode: tr.ServiceCode(),
+			TrackItemID: tr.TrackItem().ID(),
+			Speed:       tr.Speed(),
+		})
+	}
+
+	for id, route := range sim.Routes {
+		if route.Active() {
+			snap.Routes = append(snap.Routes, id)
+		}
+	}
+
+	for id, ti := range sim.TrackItems {
+		si, ok := ti.(*SignalItem)
+		if !ok || si.activeAspect == nil {
+			continue
+		}
+		snap.Signals[id] = si.activeAspect.Name
+	}
+
+	if sim.MessageLogger != nil {
+		for _, msg := range sim.MessageLogger.Messages() {
+			snap.Log = append(snap.Log, msg.String())
+		}
+	}
+
+	return snap
+}
+
+// restoreLog re-seeds l with previously recorded message text, stamped at
+// the snapshot's restore time. The original Message each line came from
+// isn't recoverable from its formatted String() output alone, so this is
+// necessarily an approximation: good enough for the log to keep showing
+// its history after a restore, not a byte-for-byte replay of it.
+func (l *MessageLogger) restoreLog(at Time, lines []string) {
+	for _, line := range lines {
+		l.messages = append(l.messages, &Message{Time: at, Text: line})
+	}
+}
+
+// RestoreSnapshot moves sim's live state (current time, train positions,
+// active routes, signal aspects, message log) to match snap. sim must
+// already be fully unmarshaled, via UnmarshalJSON, from the same
+// simulation definition the snapshot was taken from.
+func (sim *Simulation) RestoreSnapshot(snap *Snapshot) error {
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version: %d", snap.Version)
+	}
+
+	sim.Options.CurrentTime = snap.Time
+
+	for _, routeID := range snap.Routes {
+		route, ok := sim.Routes[routeID]
+		if !ok {
+			return fmt.Errorf("snapshot references unknown route: %d", routeID)
+		}
+		if err := route.Activate(true); err != nil {
+			return fmt.Errorf("unable to restore route %d: %s", routeID, err)
+		}
+	}
+
+	for _, ts := range snap.Trains {
+		train := sim.trainByServiceCode(ts.ServiceCode)
+		if train == nil {
+			return fmt.Errorf("snapshot references unknown train: %s", ts.ServiceCode)
+		}
+		ti, ok := sim.TrackItems[ts.TrackItemID]
+		if !ok {
+			return fmt.Errorf("snapshot references unknown track item: %d", ts.TrackItemID)
+		}
+		train.SetPosition(ti, ts.Speed)
+	}
+
+	for id, aspectName := range snap.Signals {
+		si, ok := sim.TrackItems[id].(*SignalItem)
+		if !ok {
+			continue
+		}
+		aspect, ok := sim.SignalLib.Aspects[aspectName]
+		if !ok {
+			return fmt.Errorf("snapshot references unknown signal aspect: %s", aspectName)
+		}
+		si.activeAspect = aspect
+	}
+
+	if sim.MessageLogger != nil {
+		sim.MessageLogger.restoreLog(snap.Time, snap.Log)
+	}
+
+	return nil
+}
+
+func (sim *Simulation) trainByServiceCode(code string) *Train {
+	for _, tr := range sim.Trains {
+		if tr.ServiceCode() == code {
+			return tr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package simulation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestSnapshotRestoreRoundTrip takes a Snapshot, sends it through JSON the
+// same way a saved game file would, and checks that RestoreSnapshot puts
+// every piece it captured - active routes, signal aspects and the message
+// log - back the way Snapshot found them. Train round-tripping isn't
+// covered here: the package has no established fixture for building a
+// *Train outside of UnmarshalJSON, unlike the newTestSignal helper this
+// test reuses for signals.
+func TestSnapshotRestoreRoundTrip(t *testing.T) {
+	st := &SignalType{
+		Name:   "testRestore",
+		States: []SignalState{{Aspect: SignalAspect{Name: "CLEAR"}}},
+	}
+	sim := &Simulation{
+		SignalLib: SignalLibrary{
+			Aspects: map[string]*SignalAspect{"CLEAR": &st.States[0].Aspect},
+			Types:   map[string]*SignalType{st.Name: st},
+		},
+		TrackItems:    map[int]TrackItem{},
+		Routes:        map[int]*Route{1: {ID: 1}},
+		MessageLogger: &MessageLogger{},
+	}
+	sim.MessageLogger.setSimulation(sim)
+	si := newTestSignal(sim, 1, st.Name)
+	sim.TrackItems[1] = si
+	si.updateSignalState()
+
+	if err := sim.Routes[1].Activate(true); err != nil {
+		t.Fatalf("Activate() = %s", err)
+	}
+	sim.MessageLogger.messages = append(sim.MessageLogger.messages, &Message{Text: "train 801 departed"})
+
+	snap := sim.Snapshot()
+
+	encoded, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("unable to encode snapshot: %s", err)
+	}
+	var decoded Snapshot
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unable to decode snapshot: %s", err)
+	}
+
+	restored := &Simulation{
+		SignalLib:     sim.SignalLib,
+		TrackItems:    sim.TrackItems,
+		Routes:        map[int]*Route{1: {ID: 1}},
+		MessageLogger: &MessageLogger{},
+	}
+	restored.MessageLogger.setSimulation(restored)
+
+	if err := restored.RestoreSnapshot(&decoded); err != nil {
+		t.Fatalf("RestoreSnapshot() = %s", err)
+	}
+
+	if !restored.Routes[1].Active() {
+		t.Error("RestoreSnapshot() did not reactivate route 1")
+	}
+	if got := si.ActiveAspect(); got == nil || got.Name != "CLEAR" {
+		t.Errorf("ActiveAspect() = %v, want CLEAR", got)
+	}
+	gotLog := restored.MessageLogger.Messages()
+	if len(gotLog) != 1 || gotLog[0].String() != "train 801 departed" {
+		t.Errorf("restored message log = %v, want [\"train 801 departed\"]", gotLog)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "gopkg.in/inconshreveable/log15.v2"
@@ -55,8 +56,183 @@ type Simulation struct {
 	MessageLogger *MessageLogger
 	EventChan     chan *Event
 
-	clockTicker *time.Ticker
-	stopChan    chan bool
+	clockMu       sync.Mutex
+	clock         *Clock
+	tickSource    TickSource
+	stopChan      chan bool
+	metrics       Metrics
+	broadcasterMu sync.Mutex
+	broadcaster   *eventBroadcaster
+}
+
+// ClockTick is the payload of a CLOCK event. It reports the simulation time
+// after the tick, and the real-time scale factor that produced it.
+type ClockTick struct {
+	Time   Time
+	Factor float64
+}
+
+// TickSource is implemented by the sources that drive Simulation.run: a
+// real-time wallClockTickSource, or a manually-stepped SteppedTickSource
+// used by tests.
+type TickSource interface {
+	// Ticks returns the channel on which sim-time increments are
+	// delivered to Simulation.run.
+	Ticks() <-chan time.Duration
+	// Stop releases any resource held by the TickSource. The Ticks
+	// channel must not be used after Stop returns.
+	Stop()
+}
+
+// Clock owns the real-time scale factor applied to wall-clock ticks. A
+// factor of 1 advances sim-time at the same rate as real time; 4 runs four
+// times faster, 0.25 four times slower.
+type Clock struct {
+	mu     sync.Mutex
+	factor float64
+}
+
+func newClock() *Clock {
+	return &Clock{factor: 1}
+}
+
+// TimeFactor returns the current real-time scale factor.
+func (c *Clock) TimeFactor() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.factor
+}
+
+// SetTimeFactor changes the real-time scale factor. It takes effect on the
+// next tick.
+func (c *Clock) SetTimeFactor(factor float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.factor = factor
+}
+
+// wallClockTickSource drives the simulation from a real-time ticker,
+// scaling the elapsed sim-time of each tick by the Clock's time factor.
+type wallClockTickSource struct {
+	ticker *time.Ticker
+	ticks  chan time.Duration
+	clock  *Clock
+	done   chan struct{}
+}
+
+func newWallClockTickSource(clock *Clock) *wallClockTickSource {
+	src := &wallClockTickSource{
+		ticker: time.NewTicker(TIME_STEP),
+		ticks:  make(chan time.Duration),
+		clock:  clock,
+		done:   make(chan struct{}),
+	}
+	go src.run()
+	return src
+}
+
+func (src *wallClockTickSource) run() {
+	for {
+		select {
+		case <-src.done:
+			return
+		case <-src.ticker.C:
+			src.ticks <- time.Duration(float64(TIME_STEP) * src.clock.TimeFactor())
+		}
+	}
+}
+
+func (src *wallClockTickSource) Ticks() <-chan time.Duration {
+	return src.ticks
+}
+
+func (src *wallClockTickSource) Stop() {
+	src.ticker.Stop()
+	close(src.done)
+}
+
+// SteppedTickSource lets tests advance the simulation clock manually,
+// without a wall-clock ticker. Use Simulation.UseSteppedClock to install
+// one before calling Start.
+type SteppedTickSource struct {
+	ticks   chan time.Duration
+	clock   *Clock
+	started bool
+}
+
+func newSteppedTickSource(clock *Clock) *SteppedTickSource {
+	return &SteppedTickSource{ticks: make(chan time.Duration), clock: clock}
+}
+
+func (src *SteppedTickSource) Ticks() <-chan time.Duration {
+	return src.ticks
+}
+
+func (src *SteppedTickSource) Stop() {
+	close(src.ticks)
+}
+
+// Step advances the simulation by n ticks of TIME_STEP, scaled by the
+// current time factor, and blocks until Simulation.run has received each
+// one. Step may return before run has finished processing the last tick.
+func (src *SteppedTickSource) Step(n int) {
+	for i := 0; i < n; i++ {
+		src.ticks <- time.Duration(float64(TIME_STEP) * src.clock.TimeFactor())
+	}
+}
+
+// UseSteppedClock switches sim to a manually stepped clock source for
+// deterministic testing, and returns it so the caller can drive ticks with
+// Step. It must be called before Start.
+func (sim *Simulation) UseSteppedClock() *SteppedTickSource {
+	sim.clockMu.Lock()
+	defer sim.clockMu.Unlock()
+	sim.clock = newClock()
+	src := newSteppedTickSource(sim.clock)
+	sim.tickSource = src
+	return src
+}
+
+// ensureClock returns sim's Clock, creating it if this is the first call.
+// It is guarded by clockMu so that SetTimeFactor (reachable from a gRPC
+// handler) racing Start, or two concurrent SetTimeFactor calls, cannot
+// each see a nil clock and create two different Clocks - the same class
+// of bug setBroadcaster/getBroadcaster guard against for sim.broadcaster.
+func (sim *Simulation) ensureClock() *Clock {
+	sim.clockMu.Lock()
+	defer sim.clockMu.Unlock()
+	if sim.clock == nil {
+		sim.clock = newClock()
+	}
+	return sim.clock
+}
+
+// SetTimeFactor changes the real-time scale factor of the simulation
+// clock and emits a CLOCK event so that clients can render at the new
+// rate.
+func (sim *Simulation) SetTimeFactor(factor float64) {
+	sim.ensureClock().SetTimeFactor(factor)
+	if sim.EventChan != nil {
+		go func() { sim.EventChan <- &Event{CLOCK, &ClockTick{sim.Options.CurrentTime, factor}} }()
+	}
+}
+
+// setBroadcaster installs b as sim's current eventBroadcaster, guarded by
+// broadcasterMu the same way Clock guards factor: Start (from its caller's
+// goroutine) and run write it while gRPC handlers (Subscribe) may read it
+// concurrently from their own goroutines.
+func (sim *Simulation) setBroadcaster(b *eventBroadcaster) {
+	sim.broadcasterMu.Lock()
+	defer sim.broadcasterMu.Unlock()
+	sim.broadcaster = b
+}
+
+// getBroadcaster returns sim's current eventBroadcaster, or nil if the
+// simulation is not running.
+func (sim *Simulation) getBroadcaster() *eventBroadcaster {
+	sim.broadcasterMu.Lock()
+	defer sim.broadcasterMu.Unlock()
+	return sim.broadcaster
 }
 
 func (sim *Simulation) UnmarshalJSON(data []byte) error {
@@ -159,6 +335,11 @@ func (sim *Simulation) UnmarshalJSON(data []byte) error {
 	}
 	sim.MessageLogger = rawSim.MessageLogger
 	sim.MessageLogger.setSimulation(sim)
+	for _, ti := range sim.TrackItems {
+		if si, ok := ti.(*SignalItem); ok {
+			si.updateSignalState()
+		}
+	}
 	return nil
 }
 
@@ -166,15 +347,40 @@ func (sim *Simulation) UnmarshalJSON(data []byte) error {
 Start runs the main loop of the simulation by making the clock tick and process each object.
 */
 func (sim *Simulation) Start() {
-	if sim.clockTicker == nil {
-		sim.clockTicker = time.NewTicker(TIME_STEP)
+	if sim.installTickSource() {
 		sim.stopChan = make(chan bool)
 		sim.EventChan = make(chan *Event)
+		sim.setBroadcaster(newEventBroadcaster(sim.EventChan))
 		go sim.run()
 		logger.Info("Simulation started")
 	}
 }
 
+// installTickSource prepares sim's clock and TickSource for Start,
+// reporting whether sim was not already running. A SteppedTickSource
+// installed by UseSteppedClock is used by the first Start after it;
+// otherwise a wall-clock TickSource is created. The check and the write
+// both happen under clockMu so a concurrent SetTimeFactor (or a second
+// overlapping Start) cannot observe a nil tickSource and race to install
+// two of them.
+func (sim *Simulation) installTickSource() bool {
+	sim.clockMu.Lock()
+	defer sim.clockMu.Unlock()
+	if sim.tickSource != nil {
+		stepped, ok := sim.tickSource.(*SteppedTickSource)
+		if !ok || stepped.started {
+			return false
+		}
+		stepped.started = true
+		return true
+	}
+	if sim.clock == nil {
+		sim.clock = newClock()
+	}
+	sim.tickSource = newWallClockTickSource(sim.clock)
+	return true
+}
+
 /*
 run enters the main loop of the simulation
 */
@@ -182,14 +388,20 @@ func (sim *Simulation) run() {
 	for {
 		select {
 		case <-sim.stopChan:
-			sim.clockTicker.Stop()
-			sim.clockTicker = nil
+			sim.tickSource.Stop()
+			sim.tickSource = nil
+			sim.getBroadcaster().stop()
+			sim.setBroadcaster(nil)
 			sim.EventChan = nil
 			logger.Info("Simulation paused")
 			return
-		case <-sim.clockTicker.C:
-			sim.Options.CurrentTime = Time{sim.Options.CurrentTime.Add(TIME_STEP)}
-			go func() { sim.EventChan <- &Event{CLOCK, &sim.Options.CurrentTime} }()
+		case elapsed := <-sim.tickSource.Ticks():
+			tickStart := time.Now()
+			sim.Options.CurrentTime = Time{sim.Options.CurrentTime.Add(elapsed)}
+			factor := sim.clock.TimeFactor()
+			go func() { sim.EventChan <- &Event{CLOCK, &ClockTick{sim.Options.CurrentTime, factor}} }()
+			sim.reportGauges()
+			sim.metricsOrNoop().ObserveTickDuration(time.Since(tickStart))
 		}
 	}
 }
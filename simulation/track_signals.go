@@ -21,9 +21,15 @@ package simulation
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 )
 
+// SIGNAL_ASPECT_CHANGED is emitted on Simulation.EventChan whenever a
+// SignalItem's ActiveAspect changes, carrying the SignalItem itself as
+// payload.
+const SIGNAL_ASPECT_CHANGED EventType = "SIGNAL_ASPECT_CHANGED"
+
 // signalLineStyle holds the possible representation shapes for the line at the
 // base of the signal.
 type signalLineStyle uint8
@@ -175,9 +181,158 @@ func (si *SignalItem) setActiveRoute(r *Route, previous TrackItem) {
 	si.updateSignalState()
 }
 
-// updateSignalState updates the current signal aspect.
+// ConditionFunc evaluates a single named condition of a SignalState for a
+// given signal. args are the raw string arguments given for that condition
+// in the simulation JSON, e.g. ["DANGER"] for "NEXT_SIGNAL_ASPECT": ["DANGER"].
+type ConditionFunc func(si *SignalItem, args []string) bool
+
+var (
+	signalConditionsMu sync.Mutex
+	signalConditions   = map[string]ConditionFunc{
+		"NEXT_SIGNAL_ASPECT":          conditionNextSignalAspect,
+		"ROUTE_SET_FORWARD":           conditionRouteSetForward,
+		"TRAIN_PRESENT_ON_NEXT_ROUTE": conditionTrainPresentOnNextRoute,
+	}
+)
+
+// RegisterSignalCondition registers the predicate used to evaluate
+// condition name in SignalState.Conditions, overriding any built-in of the
+// same name. Call it from an init() so simulations can plug in custom
+// signalling logic without forking this package.
+func RegisterSignalCondition(name string, fn ConditionFunc) {
+	signalConditionsMu.Lock()
+	defer signalConditionsMu.Unlock()
+	signalConditions[name] = fn
+}
+
+func conditionFunc(name string) (ConditionFunc, bool) {
+	signalConditionsMu.Lock()
+	defer signalConditionsMu.Unlock()
+	fn, ok := signalConditions[name]
+	return fn, ok
+}
+
+// conditionNextSignalAspect is true if the name of the next signal's
+// current aspect is one of args.
+func conditionNextSignalAspect(si *SignalItem, args []string) bool {
+	next := si.nextSignal()
+	if next == nil || next.activeAspect == nil {
+		return false
+	}
+	for _, name := range args {
+		if next.activeAspect.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionRouteSetForward is true if a route has been activated starting
+// at this signal, looking ahead.
+func conditionRouteSetForward(si *SignalItem, args []string) bool {
+	return si.nextActiveRoute != nil
+}
+
+// conditionTrainPresentOnNextRoute is true if any train in the simulation
+// currently sits on a track item of this signal's forward active route.
+func conditionTrainPresentOnNextRoute(si *SignalItem, args []string) bool {
+	route := si.nextActiveRoute
+	if route == nil || si.simulation == nil {
+		return false
+	}
+	onRoute := make(map[int]bool, len(route.Positions))
+	for _, pos := range route.Positions {
+		onRoute[pos.TrackItem().ID()] = true
+	}
+	for _, tr := range si.simulation.Trains {
+		if onRoute[tr.TrackItem().ID()] {
+			return true
+		}
+	}
+	return false
+}
+
+// nextSignal returns the SignalItem at the end of si's forward active
+// route (nextActiveRoute), or nil if no such route is active. A Route
+// always runs from one signal to the next, so that end signal is the
+// next signal si's driver will see.
+func (si *SignalItem) nextSignal() *SignalItem {
+	return si.routeSignal(si.nextActiveRoute, true)
+}
+
+// previousSignal returns the SignalItem at the start of si's backward
+// active route (previousActiveRoute), or nil if no such route is active.
+func (si *SignalItem) previousSignal() *SignalItem {
+	return si.routeSignal(si.previousActiveRoute, false)
+}
+
+// routeSignal looks up the signal at one end of route: the end signal
+// when end is true, the begin signal otherwise.
+func (si *SignalItem) routeSignal(route *Route, end bool) *SignalItem {
+	if route == nil || si.simulation == nil {
+		return nil
+	}
+	id := route.BeginSignalId
+	if end {
+		id = route.EndSignalId
+	}
+	sig, _ := si.simulation.TrackItems[id].(*SignalItem)
+	return sig
+}
+
+// updateSignalState updates the current signal aspect by evaluating each
+// of the signal's SignalType.States top-to-bottom and picking the first
+// one whose Conditions all hold, falling back to the last state when none
+// matches. When the aspect actually changes, it emits a
+// SIGNAL_ASPECT_CHANGED event and re-evaluates the upstream signal on
+// previousActiveRoute, so aspect propagation (e.g. yellow before red)
+// cascades automatically.
 func (si *SignalItem) updateSignalState() {
+	st := si.SignalType()
+	if st == nil || len(st.States) == 0 {
+		return
+	}
 
+	var chosen *SignalState
+	for i := range st.States {
+		state := &st.States[i]
+		if si.matchesState(state) {
+			chosen = state
+			break
+		}
+	}
+	if chosen == nil {
+		chosen = &st.States[len(st.States)-1]
+	}
+
+	previous := si.activeAspect
+	si.activeAspect = &chosen.Aspect
+	if previous != nil && previous.Name == si.activeAspect.Name {
+		return
+	}
+
+	if si.simulation != nil && si.simulation.EventChan != nil {
+		go func() { si.simulation.EventChan <- &Event{SIGNAL_ASPECT_CHANGED, si} }()
+	}
+	if prev := si.previousSignal(); prev != nil {
+		prev.updateSignalState()
+	}
+}
+
+// matchesState returns true if every condition of state currently holds
+// for si. An unknown condition name never matches.
+func (si *SignalItem) matchesState(state *SignalState) bool {
+	for name, args := range state.Conditions {
+		fn, ok := conditionFunc(name)
+		if !ok {
+			logger.Warn("unknown signal condition", "name", name, "signal", si.ID())
+			return false
+		}
+		if !fn(si, args) {
+			return false
+		}
+	}
+	return true
 }
 
 // resetNextActiveRoute information. If route is not nil, do
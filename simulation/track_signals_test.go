@@ -0,0 +1,270 @@
+// Copyright (C) 2008-2018 by Nicolas Piganeau and the TS2 TEAM
+// (See AUTHORS file)
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program; if not, write to the
+// Free Software Foundation, Inc.,
+// 59 Temple Place - Suite 330, Boston, MA  02111-1307, USA.
+
+package simulation
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestSignal(sim *Simulation, id int, typeCode string) *SignalItem {
+	si := &SignalItem{}
+	si.setSimulation(sim)
+	si.setId(id)
+	si.SignalTypeCode = typeCode
+	return si
+}
+
+func TestUpdateSignalStatePicksFirstMatchingState(t *testing.T) {
+	RegisterSignalCondition("TEST_ALWAYS_FALSE", func(si *SignalItem, args []string) bool { return false })
+	RegisterSignalCondition("TEST_ALWAYS_TRUE", func(si *SignalItem, args []string) bool { return true })
+
+	st := &SignalType{
+		Name: "testFirstMatch",
+		States: []SignalState{
+			{Aspect: SignalAspect{Name: "DANGER"}, Conditions: map[string][]string{"TEST_ALWAYS_FALSE": nil}},
+			{Aspect: SignalAspect{Name: "CAUTION"}, Conditions: map[string][]string{"TEST_ALWAYS_TRUE": nil}},
+			{Aspect: SignalAspect{Name: "CLEAR"}},
+		},
+	}
+	sim := &Simulation{SignalLib: SignalLibrary{Types: map[string]*SignalType{st.Name: st}}}
+	si := newTestSignal(sim, 1, st.Name)
+
+	si.updateSignalState()
+
+	if got := si.ActiveAspect(); got == nil || got.Name != "CAUTION" {
+		t.Fatalf("ActiveAspect() = %v, want CAUTION", got)
+	}
+}
+
+func TestUpdateSignalStateFallsBackToLastState(t *testing.T) {
+	RegisterSignalCondition("TEST_ALWAYS_FALSE", func(si *SignalItem, args []string) bool { return false })
+
+	st := &SignalType{
+		Name: "testFallback",
+		States: []SignalState{
+			{Aspect: SignalAspect{Name: "DANGER"}, Conditions: map[string][]string{"TEST_ALWAYS_FALSE": nil}},
+			{Aspect: SignalAspect{Name: "CLEAR"}, Conditions: map[string][]string{"TEST_ALWAYS_FALSE": nil}},
+		},
+	}
+	sim := &Simulation{SignalLib: SignalLibrary{Types: map[string]*SignalType{st.Name: st}}}
+	si := newTestSignal(sim, 2, st.Name)
+
+	si.updateSignalState()
+
+	if got := si.ActiveAspect(); got == nil || got.Name != "CLEAR" {
+		t.Fatalf("ActiveAspect() = %v, want fallback CLEAR", got)
+	}
+}
+
+func TestUpdateSignalStateEmitsEventOnlyOnChange(t *testing.T) {
+	st := &SignalType{
+		Name:   "testEvent",
+		States: []SignalState{{Aspect: SignalAspect{Name: "CLEAR"}}},
+	}
+	sim := &Simulation{
+		SignalLib: SignalLibrary{Types: map[string]*SignalType{st.Name: st}},
+		EventChan: make(chan *Event, 1),
+	}
+	si := newTestSignal(sim, 3, st.Name)
+
+	si.updateSignalState()
+	select {
+	case evt := <-sim.EventChan:
+		if evt.Name != SIGNAL_ASPECT_CHANGED {
+			t.Fatalf("event.Name = %v, want SIGNAL_ASPECT_CHANGED", evt.Name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for SIGNAL_ASPECT_CHANGED event")
+	}
+
+	si.updateSignalState()
+	select {
+	case evt := <-sim.EventChan:
+		t.Fatalf("unexpected second event %v: aspect did not change", evt)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestConditionRouteSetForward(t *testing.T) {
+	si := &SignalItem{}
+	if conditionRouteSetForward(si, nil) {
+		t.Fatal("conditionRouteSetForward() = true with no active route")
+	}
+	si.nextActiveRoute = &Route{}
+	if !conditionRouteSetForward(si, nil) {
+		t.Fatal("conditionRouteSetForward() = false with an active route")
+	}
+}
+
+func TestPreviousSignalWithNoActiveRoute(t *testing.T) {
+	si := &SignalItem{}
+	if got := si.previousSignal(); got != nil {
+		t.Fatalf("previousSignal() = %v, want nil", got)
+	}
+}
+
+// threeAspectSignalType returns a CLEAR/CAUTION/DANGER SignalType: CLEAR
+// requires a route set ahead and the next signal also showing CLEAR;
+// CAUTION only requires a route set ahead; DANGER is the fallback.
+func threeAspectSignalType(name string) *SignalType {
+	return &SignalType{
+		Name: name,
+		States: []SignalState{
+			{
+				Aspect: SignalAspect{Name: "CLEAR"},
+				Conditions: map[string][]string{
+					"ROUTE_SET_FORWARD":  nil,
+					"NEXT_SIGNAL_ASPECT": {"CLEAR"},
+				},
+			},
+			{
+				Aspect:     SignalAspect{Name: "CAUTION"},
+				Conditions: map[string][]string{"ROUTE_SET_FORWARD": nil},
+			},
+			{Aspect: SignalAspect{Name: "DANGER"}},
+		},
+	}
+}
+
+// TestSignalAspectPropagation builds a minimal 3-signal layout,
+// S1 --routeA--> S2 --routeB--> S3, and exercises the real
+// ROUTE_SET_FORWARD/NEXT_SIGNAL_ASPECT conditions end to end: at load
+// time S1 and S2 fall back to DANGER while the terminus S3 shows CLEAR;
+// activating a route forward
+// of a signal can bring it up to CAUTION or CLEAR depending on what the
+// next signal shows; and a single change at S3 cascades backwards
+// through previousActiveRoute to update S2 and then S1 automatically.
+func TestSignalAspectPropagation(t *testing.T) {
+	clearAhead := true
+	RegisterSignalCondition("TEST_BLOCK_CLEAR", func(si *SignalItem, args []string) bool { return clearAhead })
+
+	terminusType := &SignalType{
+		Name: "testTerminus",
+		States: []SignalState{
+			{Aspect: SignalAspect{Name: "CLEAR"}, Conditions: map[string][]string{"TEST_BLOCK_CLEAR": nil}},
+			{Aspect: SignalAspect{Name: "DANGER"}},
+		},
+	}
+	threeAspect := threeAspectSignalType("testThreeAspect")
+
+	sim := &Simulation{
+		SignalLib: SignalLibrary{Types: map[string]*SignalType{
+			terminusType.Name: terminusType,
+			threeAspect.Name:  threeAspect,
+		}},
+	}
+	s1 := newTestSignal(sim, 1, threeAspect.Name)
+	s2 := newTestSignal(sim, 2, threeAspect.Name)
+	s3 := newTestSignal(sim, 3, terminusType.Name)
+	sim.TrackItems = map[int]TrackItem{1: s1, 2: s2, 3: s3}
+
+	routeA := &Route{ID: 100, BeginSignalId: 1, EndSignalId: 2}
+	routeB := &Route{ID: 200, BeginSignalId: 2, EndSignalId: 3}
+
+	// At load time, with no route active anywhere, S1 and S2 must fall
+	// back to DANGER rather than being left uncomputed, while the
+	// terminus S3 shows CLEAR because its only condition holds.
+	for _, si := range []*SignalItem{s1, s2, s3} {
+		si.updateSignalState()
+	}
+	if got := s3.ActiveAspect().Name; got != "CLEAR" {
+		t.Fatalf("s3 ActiveAspect = %s, want CLEAR (terminus has no forward condition)", got)
+	}
+	if got := s2.ActiveAspect().Name; got != "DANGER" {
+		t.Fatalf("s2 ActiveAspect = %s, want DANGER before any route is set", got)
+	}
+	if got := s1.ActiveAspect().Name; got != "DANGER" {
+		t.Fatalf("s1 ActiveAspect = %s, want DANGER before any route is set", got)
+	}
+
+	// Activate routeB (S2 -> S3): S2 now sees a route set forward and a
+	// CLEAR signal ahead, so it should go to CLEAR.
+	s2.nextActiveRoute = routeB
+	s3.previousActiveRoute = routeB
+	s2.updateSignalState()
+	if got := s2.ActiveAspect().Name; got != "CLEAR" {
+		t.Fatalf("s2 ActiveAspect = %s, want CLEAR once routeB is set and s3 is CLEAR", got)
+	}
+
+	// Activate routeA (S1 -> S2): S1 sees a route set forward and S2
+	// showing CLEAR, so it should also go to CLEAR.
+	s1.nextActiveRoute = routeA
+	s2.previousActiveRoute = routeA
+	s1.updateSignalState()
+	if got := s1.ActiveAspect().Name; got != "CLEAR" {
+		t.Fatalf("s1 ActiveAspect = %s, want CLEAR once routeA is set and s2 is CLEAR", got)
+	}
+
+	// Block the line ahead of S3: a single update of S3 must cascade
+	// backwards through previousActiveRoute, downgrading S2 to CAUTION
+	// and then S1 to CAUTION, without anyone calling updateSignalState
+	// on S2 or S1 directly.
+	clearAhead = false
+	s3.updateSignalState()
+
+	if got := s3.ActiveAspect().Name; got != "DANGER" {
+		t.Fatalf("s3 ActiveAspect = %s, want DANGER once blocked", got)
+	}
+	if got := s2.ActiveAspect().Name; got != "CAUTION" {
+		t.Fatalf("s2 ActiveAspect = %s, want CAUTION to have propagated from s3", got)
+	}
+	if got := s1.ActiveAspect().Name; got != "CAUTION" {
+		t.Fatalf("s1 ActiveAspect = %s, want CAUTION to have propagated from s2", got)
+	}
+}
+
+// TestReverseSignalUsesSameConditionLogic checks that a reverse signal
+// (Reverse == true, for trains coming from the right) is driven by the
+// same condition evaluator as a forward signal: orientation only affects
+// Reversed(), not how its aspect is computed.
+func TestReverseSignalUsesSameConditionLogic(t *testing.T) {
+	threeAspect := threeAspectSignalType("testReverseThreeAspect")
+	terminusType := &SignalType{
+		Name:   "testReverseTerminus",
+		States: []SignalState{{Aspect: SignalAspect{Name: "DANGER"}}},
+	}
+	sim := &Simulation{SignalLib: SignalLibrary{Types: map[string]*SignalType{
+		threeAspect.Name:  threeAspect,
+		terminusType.Name: terminusType,
+	}}}
+
+	rs := newTestSignal(sim, 4, threeAspect.Name)
+	rs.Reverse = true
+	rsAhead := newTestSignal(sim, 5, terminusType.Name)
+	sim.TrackItems = map[int]TrackItem{4: rs, 5: rsAhead}
+
+	rs.updateSignalState()
+	if !rs.Reversed() {
+		t.Fatal("Reversed() = false, want true")
+	}
+	if got := rs.ActiveAspect().Name; got != "DANGER" {
+		t.Fatalf("ActiveAspect() = %s, want DANGER with no route set", got)
+	}
+
+	// rsAhead always shows DANGER, so setting a route ahead of the
+	// reverse signal brings it only as far as CAUTION, never CLEAR -
+	// the same condition logic a forward signal would get.
+	rsAhead.updateSignalState()
+	rs.nextActiveRoute = &Route{ID: 300, BeginSignalId: 4, EndSignalId: 5}
+	rs.updateSignalState()
+	if got := rs.ActiveAspect().Name; got != "CAUTION" {
+		t.Fatalf("ActiveAspect() = %s, want CAUTION once a route is set ahead", got)
+	}
+}